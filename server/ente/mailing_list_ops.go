@@ -0,0 +1,65 @@
+package ente
+
+// MailingListOpType identifies the action that a queued mailing_list_ops
+// row should perform when it is dequeued by the outbox worker.
+type MailingListOpType string
+
+const (
+	MailingListOpSubscribe   MailingListOpType = "subscribe"
+	MailingListOpUnsubscribe MailingListOpType = "unsubscribe"
+	MailingListOpUpdateEmail MailingListOpType = "update_email"
+)
+
+// MailingListOpStatus is the lifecycle state of a queued op.
+type MailingListOpStatus string
+
+const (
+	MailingListOpStatusPending      MailingListOpStatus = "pending"
+	MailingListOpStatusDone         MailingListOpStatus = "done"
+	MailingListOpStatusDeadLettered MailingListOpStatus = "dead_lettered"
+)
+
+// MailingListOp is a single queued mutation against a mailing list provider,
+// persisted so that it survives a restart or a provider outage and can be
+// retried with backoff by the MailingListsController's outbox worker.
+type MailingListOp struct {
+	ID int64
+	// Type is the action to perform - subscribe, unsubscribe or
+	// update_email.
+	Type MailingListOpType
+	// Provider is the name of the provider this op should be replayed
+	// against (e.g. "zoho"), recorded at enqueue time so that a later change
+	// to `mailing_lists.provider` does not cause in-flight ops to be
+	// replayed against the wrong backend.
+	Provider string
+	// UserID is the ente account this op was enqueued on behalf of, used to
+	// look up the account's current per-topic preferences at delivery time.
+	UserID int64
+	// Email is the address the op applies to. For MailingListOpUpdateEmail
+	// this is the old address, and NewEmail holds the new one.
+	Email    string
+	NewEmail string
+	// TopicIDs restricts a MailingListOpSubscribe to this set of topics,
+	// snapshotted at enqueue time from the account's stored preferences.
+	//
+	// An empty TopicIDs is ambiguous on its own - it means either "no
+	// selection was made at enqueue time, resolve the account's current
+	// preferences at delivery instead" (e.g. on signup) or "the account
+	// explicitly chose zero topics" (opted out of everything via
+	// SetSubscriptions). HasTopicSelection disambiguates the two.
+	TopicIDs []TopicID
+	// HasTopicSelection is true when TopicIDs was set explicitly at enqueue
+	// time (even if empty), and false when it should instead be resolved
+	// from the account's current preferences at delivery time.
+	HasTopicSelection bool
+	// AttemptCount is the number of times we've tried (and failed) to
+	// perform this op so far.
+	AttemptCount int
+	// NextAttemptAt is the earliest time (in epoch microseconds) at which
+	// the worker should next try this op.
+	NextAttemptAt int64
+	// LastError is the error message from the most recent failed attempt,
+	// kept around for debugging via the admin endpoint.
+	LastError string
+	Status    MailingListOpStatus
+}
@@ -0,0 +1,14 @@
+package ente
+
+// TopicID identifies a single mailing list topic (e.g. "product-updates",
+// "security", "newsletter") in a provider-agnostic way. Providers translate
+// it to whatever they call the concept natively - a Zoho topic ID, a Mailgun
+// tag, a Mailman3/Listmonk list ID.
+type TopicID string
+
+// Topic is a stream of mail that a customer can independently opt in or out
+// of, as surfaced to clients via the `/users/me/email-preferences` API.
+type Topic struct {
+	ID   TopicID `json:"id"`
+	Name string  `json:"name"`
+}
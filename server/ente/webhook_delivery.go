@@ -0,0 +1,52 @@
+package ente
+
+// WebhookDeliveryStatus is the lifecycle state of a queued delivery.
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending      WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusDone         WebhookDeliveryStatus = "done"
+	WebhookDeliveryStatusDeadLettered WebhookDeliveryStatus = "dead_lettered"
+)
+
+// WebhookDelivery is a single queued (or attempted, or completed) POST of an
+// Event to one HTTP subscriber's target URL, persisted so that it survives a
+// restart or a subscriber outage and can be retried with backoff by
+// WebhooksController's outbox worker.
+//
+// This is the HTTP counterpart of MailingListOp - the two are deliberately
+// kept as separate tables/types rather than unified, since a delivery is
+// scoped to one (event, subscriber) pair rather than to a provider-wide
+// action.
+type WebhookDelivery struct {
+	ID int64
+	// EventType is recorded alongside Payload purely for operator
+	// visibility (e.g. filtering the admin "dead lettered" view by event
+	// type) - replaying a delivery never needs to interpret it, since
+	// Payload is already the final JSON to send.
+	EventType EventType
+	// Payload is the JSON-encoded Event, frozen at enqueue time so that a
+	// later change to the user's account doesn't change what a retried
+	// delivery sends.
+	Payload string
+	// Target is the subscriber's URL, and Secret is the key used to sign
+	// the request body, both as configured under `webhooks.subscriptions`
+	// at enqueue time.
+	//
+	// Secret is excluded from JSON serialization - it's the HMAC signing
+	// secret for the subscriber's target, and the admin dead-letter endpoint
+	// (see AdminWebhooksHandler.GetDeadLettered) would otherwise hand it to
+	// anyone who can view that page.
+	Target string
+	Secret string `json:"-"`
+	// AttemptCount is the number of times we've tried (and failed) to
+	// deliver this so far.
+	AttemptCount int
+	// NextAttemptAt is the earliest time (in epoch microseconds) at which
+	// the worker should next try this delivery.
+	NextAttemptAt int64
+	// LastError is the error message from the most recent failed attempt,
+	// kept around for debugging via the admin endpoint.
+	LastError string
+	Status    WebhookDeliveryStatus
+}
@@ -0,0 +1,27 @@
+package ente
+
+// EventType identifies the kind of account lifecycle event that subscribers
+// (see WebhooksController) can register interest in.
+type EventType string
+
+const (
+	EventUserCreated         EventType = "user.created"
+	EventUserEmailChanged    EventType = "user.email_changed"
+	EventUserDeleted         EventType = "user.deleted"
+	EventSubscriptionChanged EventType = "subscription.changed"
+)
+
+// Event is the payload published to subscribers - both the built-in,
+// in-process ones (e.g. MailingListsController) and the third-party HTTP
+// ones configured under `webhooks.subscriptions` - when something happens to
+// a user's account.
+//
+// Not every field is populated for every EventType, e.g. NewEmail is only
+// set for EventUserEmailChanged and PlanID only for EventSubscriptionChanged.
+type Event struct {
+	Type     EventType `json:"type"`
+	UserID   int64     `json:"userID"`
+	Email    string    `json:"email"`
+	NewEmail string    `json:"newEmail,omitempty"`
+	PlanID   string    `json:"planID,omitempty"`
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ente-io/museum/pkg/controller"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMailingListOpsHandler exposes endpoints for operators to inspect and
+// replay dead-lettered mailing_list_ops rows, since those represent a
+// subscribe/unsubscribe/update-email that we gave up retrying automatically.
+type AdminMailingListOpsHandler struct {
+	MailingListsController *controller.MailingListsController
+}
+
+// GetDeadLettered returns the ops that exhausted their retries.
+func (h *AdminMailingListOpsHandler) GetDeadLettered(c *gin.Context) {
+	ops, err := h.MailingListsController.Repo.GetDeadLettered()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ops": ops})
+}
+
+// ReplayDeadLettered moves a dead-lettered op back to pending so the outbox
+// worker picks it up again on its next poll.
+func (h *AdminMailingListOpsHandler) ReplayDeadLettered(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := h.MailingListsController.ReplayDeadLettered(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
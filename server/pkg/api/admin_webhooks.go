@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ente-io/museum/pkg/controller"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminWebhooksHandler exposes endpoints for operators to inspect and replay
+// dead-lettered webhook_deliveries rows, since those represent an event that
+// a subscriber's target URL never successfully received.
+type AdminWebhooksHandler struct {
+	WebhooksController *controller.WebhooksController
+}
+
+// GetDeadLettered returns the deliveries that exhausted their retries.
+func (h *AdminWebhooksHandler) GetDeadLettered(c *gin.Context) {
+	deliveries, err := h.WebhooksController.Repo.GetDeadLettered()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// ReplayDeadLettered moves a dead-lettered delivery back to pending so the
+// outbox worker picks it up again on its next poll.
+func (h *AdminWebhooksHandler) ReplayDeadLettered(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := h.WebhooksController.ReplayDeadLettered(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/museum/pkg/controller"
+	"github.com/ente-io/museum/pkg/utils/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// EmailPreferencesHandler serves `/users/me/email-preferences`, letting
+// clients render a preferences pane for the per-topic mailing list
+// subscriptions introduced alongside MailingListsController.SetSubscriptions.
+type EmailPreferencesHandler struct {
+	MailingListsController *controller.MailingListsController
+}
+
+type getEmailPreferencesResponse struct {
+	Topics     []ente.Topic   `json:"topics"`
+	Subscribed []ente.TopicID `json:"subscribed"`
+}
+
+// GetEmailPreferences returns every topic along with which of them the
+// logged in user is currently subscribed to.
+func (h *EmailPreferencesHandler) GetEmailPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c.Request.Header)
+
+	topics, err := h.MailingListsController.ListTopics()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	subscribed, err := h.MailingListsController.GetSubscriptions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, getEmailPreferencesResponse{Topics: topics, Subscribed: subscribed})
+}
+
+// Subscribed intentionally has no `binding:"required"` - gin's validator
+// treats that as "non-empty slice", which would make it impossible for a
+// user to submit an empty selection to opt out of every topic.
+type setEmailPreferencesRequest struct {
+	Subscribed []ente.TopicID `json:"subscribed"`
+}
+
+// SetEmailPreferences replaces the logged in user's topic subscriptions.
+func (h *EmailPreferencesHandler) SetEmailPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c.Request.Header)
+
+	var req setEmailPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.MailingListsController.SetSubscriptions(userID, req.Subscribed); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ente-io/museum/pkg/controller"
+	"github.com/gin-gonic/gin"
+)
+
+// MailingListUnsubscribeHandler serves the public, unauthenticated one-click
+// unsubscribe endpoint that mail clients hit on the recipient's behalf when
+// they use the List-Unsubscribe button, per RFC 8058.
+type MailingListUnsubscribeHandler struct {
+	MailingListsController *controller.MailingListsController
+}
+
+// OneClickUnsubscribe handles `List-Unsubscribe=One-Click` POSTs.
+//
+// Per RFC 8058, this must not require authentication (the mail client sends
+// it without the recipient's ente session) - the signed token is what we
+// rely on to know which recipient and list this request is for.
+func (h *MailingListUnsubscribeHandler) OneClickUnsubscribe(c *gin.Context) {
+	token := c.Query("token")
+	reason := c.PostForm("reason")
+
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	// The email acted on comes from the signed token, not the query string -
+	// the query string's `email` is only there so mail clients can show a
+	// mailto: fallback, it is never trusted for the unsubscribe itself.
+	if err := h.MailingListsController.UnsubscribeOneClick(token, reason); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "could not unsubscribe"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
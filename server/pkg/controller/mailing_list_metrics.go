@@ -0,0 +1,21 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	mailingListOutboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mailing_list_outbox_pending",
+		Help: "Number of mailing list ops currently waiting to be delivered",
+	})
+	mailingListOutboxFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mailing_list_outbox_failures_total",
+		Help: "Number of mailing list op attempts that failed",
+	})
+	mailingListOutboxDeadLettered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mailing_list_outbox_dead_lettered_total",
+		Help: "Number of mailing list ops that exhausted their retries",
+	})
+)
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/ente-io/museum/ente"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// mailingListOutboxMaxAttempts is the number of times we retry an op
+	// before giving up on it and dead-lettering it instead.
+	mailingListOutboxMaxAttempts = 8
+	// mailingListOutboxPollInterval is how often the worker checks for ops
+	// that are due to be (re)attempted.
+	mailingListOutboxPollInterval = 10 * time.Second
+	// mailingListOutboxBatchSize bounds how many ops we pull per poll, so a
+	// large backlog doesn't monopolize the worker's time.
+	mailingListOutboxBatchSize = 50
+)
+
+// RunOutboxWorker polls the mailing_list_ops outbox and replays pending ops
+// against the provider, retrying with exponential backoff and jitter on
+// failure. It blocks, so callers should run it in its own goroutine, e.g.
+//
+//	go mlController.RunOutboxWorker(stop)
+//
+// This is what lets Subscribe/Unsubscribe/UpdateEmail enqueue and return
+// immediately - a Zoho (or Mailgun, or ...) outage delays delivery instead of
+// failing the signup/deletion/email-change request that triggered it.
+func (c *MailingListsController) RunOutboxWorker(stop <-chan struct{}) {
+	ticker := time.NewTicker(mailingListOutboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.processDueOps()
+		}
+	}
+}
+
+func (c *MailingListsController) processDueOps() {
+	now := nowMicro()
+	ops, err := c.Repo.GetDueOps(now, mailingListOutboxBatchSize)
+	if err != nil {
+		log.Errorf("Mailing list outbox - could not fetch due ops: %s", err)
+		return
+	}
+
+	for _, op := range ops {
+		c.processOp(op)
+	}
+
+	if pending, err := c.Repo.CountDueOps(now); err == nil {
+		mailingListOutboxPending.Set(float64(pending))
+	} else {
+		log.Errorf("Mailing list outbox - could not count pending ops: %s", err)
+	}
+}
+
+func (c *MailingListsController) processOp(op ente.MailingListOp) {
+	provider := c.providerFor(op.Provider)
+
+	var err error
+	switch op.Type {
+	case ente.MailingListOpSubscribe:
+		topicIDs, hasSelection := op.TopicIDs, op.HasTopicSelection
+		if !hasSelection && op.UserID != 0 {
+			// The op was enqueued without an explicit topic selection (e.g.
+			// on signup) - resolve the account's current preferences now,
+			// rather than at enqueue time, so a preference change made while
+			// this op was sitting in the outbox still takes effect.
+			topicIDs, hasSelection, err = c.resolveSubscribedTopics(provider, op.UserID)
+			if err != nil {
+				break
+			}
+		}
+		if hasSelection && len(topicIDs) == 0 {
+			// An explicit, empty selection means the account opted out of
+			// every topic - every provider's Subscribe treats an empty
+			// topicIDs as "use the provider's full default set" instead, so
+			// that would otherwise resubscribe them to everything.
+			err = provider.Unsubscribe(op.Email)
+		} else {
+			err = provider.Subscribe(op.Email, topicIDs)
+		}
+	case ente.MailingListOpUnsubscribe:
+		err = provider.Unsubscribe(op.Email)
+	case ente.MailingListOpUpdateEmail:
+		// Subscribe the new address before unsubscribing the old one, and in
+		// particular before recording either step as done, so that a crash or
+		// a retry never leaves us in a state where the customer is on neither
+		// address - at worst, under retry, they end up briefly on both, which
+		// Subscribe/Unsubscribe both tolerate.
+		topicIDs, hasSelection, topicErr := c.resolveSubscribedTopics(provider, op.UserID)
+		if topicErr != nil {
+			err = topicErr
+			break
+		}
+		if !(hasSelection && len(topicIDs) == 0) {
+			if err = provider.Subscribe(op.NewEmail, topicIDs); err != nil {
+				break
+			}
+		}
+		err = provider.Unsubscribe(op.Email)
+	default:
+		log.Errorf("Mailing list outbox - unknown op type %q for op %d, dead-lettering", op.Type, op.ID)
+		_ = c.Repo.MarkFailed(op.ID, mailingListOutboxMaxAttempts, mailingListOutboxMaxAttempts, "unknown op type", nowMicro(), nowMicro())
+		return
+	}
+
+	now := nowMicro()
+	if err == nil {
+		if markErr := c.Repo.MarkSucceeded(op.ID, now); markErr != nil {
+			log.Errorf("Mailing list outbox - could not mark op %d as succeeded: %s", op.ID, markErr)
+		}
+		return
+	}
+
+	mailingListOutboxFailures.Inc()
+	attemptCount := op.AttemptCount + 1
+	nextAttemptAt := now + backoffWithJitter(attemptCount).Microseconds()
+	if markErr := c.Repo.MarkFailed(op.ID, attemptCount, mailingListOutboxMaxAttempts, err.Error(), nextAttemptAt, now); markErr != nil {
+		log.Errorf("Mailing list outbox - could not mark op %d as failed: %s", op.ID, markErr)
+	}
+	if attemptCount >= mailingListOutboxMaxAttempts {
+		mailingListOutboxDeadLettered.Inc()
+		log.Errorf("Mailing list outbox - op %d for '%s' dead-lettered after %d attempts: %s", op.ID, op.Email, attemptCount, err)
+	} else {
+		log.Warnf("Mailing list outbox - op %d for '%s' failed (attempt %d): %s", op.ID, op.Email, attemptCount, err)
+	}
+}
+
+// resolveSubscribedTopics looks up userID's current per-topic preferences,
+// defaulting to every topic if they've never set any. The returned bool
+// mirrors UserEmailPreferencesRepository.GetSubscribedTopics' hasPreferences
+// - callers must check it before treating an empty topicIDs as "opted out of
+// everything" rather than "no preference recorded".
+func (c *MailingListsController) resolveSubscribedTopics(provider MailingListProvider, userID int64) ([]ente.TopicID, bool, error) {
+	allTopics, err := provider.ListTopics()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(allTopics) == 0 {
+		return nil, false, nil
+	}
+	return c.UserEmailPreferences.GetSubscribedTopics(userID, allTopics)
+}
+
+// backoffWithJitter returns an exponential backoff duration for the given
+// attempt number (1-indexed), capped at an hour and with up to 30% jitter so
+// that a burst of failures doesn't result in a thundering herd of retries.
+func backoffWithJitter(attempt int) time.Duration {
+	// Clamp in float64 seconds before converting to a Duration - 2^attempt
+	// seconds only overflows int64 nanoseconds from around attempt 34, well
+	// past mailingListOutboxMaxAttempts, but an attempt count from outside this
+	// package (or a future change to that constant) shouldn't be able to wrap
+	// this negative and make rand.Int63n below panic.
+	seconds := math.Pow(2, float64(attempt))
+	if maxSeconds := time.Hour.Seconds(); seconds > maxSeconds {
+		seconds = maxSeconds
+	}
+	base := time.Duration(seconds * float64(time.Second))
+	jitter := time.Duration(rand.Int63n(int64(base) * 3 / 10))
+	return base + jitter
+}
+
+func nowMicro() int64 {
+	return time.Now().UnixMicro()
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffWithJitterGrowsWithAttempt(t *testing.T) {
+	if d := backoffWithJitter(1); d < 2*time.Second || d >= 2*time.Second+2*time.Second*3/10 {
+		t.Fatalf("attempt 1: got %s, want roughly [2s, 2.6s)", d)
+	}
+	if d := backoffWithJitter(3); d < 8*time.Second || d >= 8*time.Second+8*time.Second*3/10 {
+		t.Fatalf("attempt 3: got %s, want roughly [8s, 10.4s)", d)
+	}
+}
+
+// TestBackoffWithJitterIsCapped guards against an unbounded exponential
+// backoff eventually overflowing or leaving a dead-lettered-in-waiting op
+// retried once a decade - attempts well past the series' max attempt count
+// should still land within a bounded window around the cap.
+func TestBackoffWithJitterIsCapped(t *testing.T) {
+	d := backoffWithJitter(40)
+	if d < time.Hour || d >= time.Hour+time.Hour*3/10 {
+		t.Fatalf("got %s, want roughly [1h, 1.3h)", d)
+	}
+}
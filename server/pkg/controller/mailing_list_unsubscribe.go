@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/stacktrace"
+	"github.com/spf13/viper"
+)
+
+// unsubscribeTokenSeparator joins the fields that go into a one-click
+// unsubscribe token before it is signed/verified.
+const unsubscribeTokenSeparator = "."
+
+// UnsubscribeHeaders returns the List-Unsubscribe and List-Unsubscribe-Post
+// header values that the transactional mail sender should attach to any
+// campaign/notification email sent to userID at email, so that the
+// recipient's mail client can offer a one-click "Unsubscribe" button per RFC
+// 8058, without them needing to dig through a preferences page.
+//
+// listKey identifies which list/topic this particular mail belongs to, and
+// is embedded in the token so that UnsubscribeOneClick can record it
+// alongside the unsubscribe. The unsubscribe itself removes the recipient
+// from every topic, not only from listKey.
+//
+// No caller attaches these headers yet - the transactional mail sender that
+// would do so (whatever actually puts a campaign/notification email on the
+// wire) isn't part of this checkout either, same as the account handlers
+// noted on WebhooksController. The tests in mailing_list_unsubscribe_test.go
+// exercise signUnsubscribeToken/verifyUnsubscribeToken; nothing exercises
+// UnsubscribeHeaders itself.
+func (c *MailingListsController) UnsubscribeHeaders(userID int64, email string, listKey string) (listUnsubscribe string, listUnsubscribePost string) {
+	token := c.signUnsubscribeToken(userID, email, listKey)
+	unsubscribeURL := fmt.Sprintf("%s/mailing-lists/unsubscribe?token=%s&email=%s",
+		viper.GetString("apps.public-albums"), token, url.QueryEscape(email))
+	listUnsubscribe = fmt.Sprintf("<mailto:%s>, <%s>", email, unsubscribeURL)
+	listUnsubscribePost = "List-Unsubscribe=One-Click"
+	return listUnsubscribe, listUnsubscribePost
+}
+
+// UnsubscribeOneClick verifies token and, if valid, unsubscribes the email
+// address it was minted for, recording reason for later analysis.
+//
+// The email acted on is always the one signed into the token, never the
+// caller-supplied query-string email - otherwise anyone who has received one
+// legitimate unsubscribe link could replay it with a different email and
+// unsubscribe an arbitrary recipient from the list.
+//
+// This is the handler for RFC 8058 one-click unsubscribes - mail clients
+// (and Gmail/Yahoo's bulk-sender requirements) expect this to be a plain,
+// unauthenticated POST, so the token itself is what proves the request is
+// legitimate.
+func (c *MailingListsController) UnsubscribeOneClick(token string, reason string) error {
+	_, email, listKey, err := c.verifyUnsubscribeToken(token)
+	if err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+
+	if err := c.Unsubscribe(email); err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+
+	return stacktrace.Propagate(c.UnsubscribeEventsRepo.Record(email, listKey, reason, nowMicro()), "")
+}
+
+func (c *MailingListsController) signUnsubscribeToken(userID int64, email string, listKey string) string {
+	// email is base64url-encoded before going into the token, since it's the
+	// only field that can itself contain unsubscribeTokenSeparator (a dot) -
+	// every real email address has one - which would otherwise throw off the
+	// fixed field count verifyUnsubscribeToken splits on.
+	encodedEmail := base64.RawURLEncoding.EncodeToString([]byte(email))
+	payload := fmt.Sprintf("%d%s%s%s%s", userID, unsubscribeTokenSeparator, encodedEmail, unsubscribeTokenSeparator, listKey)
+	return fmt.Sprintf("%s%s%s", payload, unsubscribeTokenSeparator, c.signPayload(payload))
+}
+
+func (c *MailingListsController) signPayload(payload string) string {
+	mac := hmac.New(sha256.New, c.unsubscribeSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *MailingListsController) verifyUnsubscribeToken(token string) (int64, string, string, error) {
+	parts := strings.Split(token, unsubscribeTokenSeparator)
+	if len(parts) != 4 {
+		return 0, "", "", stacktrace.Propagate(ente.ErrBadRequest, "malformed unsubscribe token")
+	}
+	userIDPart, encodedEmail, listKey, signature := parts[0], parts[1], parts[2], parts[3]
+
+	payload := fmt.Sprintf("%s%s%s%s%s", userIDPart, unsubscribeTokenSeparator, encodedEmail, unsubscribeTokenSeparator, listKey)
+	expectedSignature := c.signPayload(payload)
+	if subtle.ConstantTimeCompare([]byte(expectedSignature), []byte(signature)) != 1 {
+		return 0, "", "", stacktrace.Propagate(ente.ErrPermissionDenied, "unsubscribe token signature mismatch")
+	}
+
+	userID, err := strconv.ParseInt(userIDPart, 10, 64)
+	if err != nil {
+		return 0, "", "", stacktrace.Propagate(ente.ErrBadRequest, "malformed unsubscribe token")
+	}
+	emailBytes, err := base64.RawURLEncoding.DecodeString(encodedEmail)
+	if err != nil {
+		return 0, "", "", stacktrace.Propagate(ente.ErrBadRequest, "malformed unsubscribe token")
+	}
+	return userID, string(emailBytes), listKey, nil
+}
+
+func (c *MailingListsController) unsubscribeSecret() []byte {
+	return []byte(viper.GetString("mailing_lists.unsubscribe-secret"))
+}
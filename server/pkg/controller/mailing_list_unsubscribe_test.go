@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func newTestMailingListsController(t *testing.T) *MailingListsController {
+	t.Helper()
+	viper.Set("mailing_lists.unsubscribe-secret", "test-secret")
+	t.Cleanup(func() { viper.Set("mailing_lists.unsubscribe-secret", nil) })
+	return &MailingListsController{}
+}
+
+func TestUnsubscribeTokenRoundTrip(t *testing.T) {
+	c := newTestMailingListsController(t)
+
+	token := c.signUnsubscribeToken(42, "user.name+tag@example.com", "product-updates")
+
+	userID, email, listKey, err := c.verifyUnsubscribeToken(token)
+	if err != nil {
+		t.Fatalf("verifyUnsubscribeToken returned an error for a token it just signed: %s", err)
+	}
+	if userID != 42 {
+		t.Errorf("got userID %d, want 42", userID)
+	}
+	if email != "user.name+tag@example.com" {
+		t.Errorf("got email %q, want the original address with its dots intact", email)
+	}
+	if listKey != "product-updates" {
+		t.Errorf("got listKey %q, want %q", listKey, "product-updates")
+	}
+}
+
+// TestUnsubscribeTokenRejectsTamperedSignature guards the IDOR this token
+// scheme exists to close: a token whose signature no longer matches its
+// payload must not verify, which is what stops a token from being edited to
+// name a different email.
+func TestUnsubscribeTokenRejectsTamperedSignature(t *testing.T) {
+	c := newTestMailingListsController(t)
+
+	token := c.signUnsubscribeToken(42, "victim@example.com", "product-updates")
+	tampered := token[:len(token)-1] + "x"
+
+	if _, _, _, err := c.verifyUnsubscribeToken(tampered); err == nil {
+		t.Fatal("expected a tampered token to fail verification")
+	}
+}
+
+func TestUnsubscribeTokenRejectsMalformedInput(t *testing.T) {
+	c := newTestMailingListsController(t)
+
+	if _, _, _, err := c.verifyUnsubscribeToken("not-enough-parts"); err == nil {
+		t.Fatal("expected a malformed token to fail verification")
+	}
+}
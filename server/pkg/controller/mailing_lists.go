@@ -1,34 +1,143 @@
 package controller
 
 import (
-	"fmt"
-	"net/url"
-	"strings"
+	"database/sql"
 
 	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/museum/pkg/external/listmonk"
+	"github.com/ente-io/museum/pkg/external/logmailer"
+	"github.com/ente-io/museum/pkg/external/mailgun"
 	"github.com/ente-io/museum/pkg/external/zoho"
+	"github.com/ente-io/museum/pkg/repo"
 	"github.com/ente-io/stacktrace"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// MailingListProvider is implemented by the various external mailing list
+// services (and the "log-only" stand-in used for development) that the
+// MailingListsController can keep in sync with our customers' emails.
+//
+// Implementations live alongside the external API client they wrap, e.g.
+// pkg/external/zoho, pkg/external/mailgun and pkg/external/listmonk.
+type MailingListProvider interface {
+	// Subscribe adds email to the provider's mailing list(s).
+	//
+	// If topicIDs is non-empty, email is only subscribed to those topics
+	// instead of the provider's default set - this is how per-topic
+	// preferences (see MailingListsController.SetSubscriptions) get
+	// translated into a provider-native call.
+	//
+	// It is valid to resubscribe an email that has previously been
+	// unsubscribed.
+	Subscribe(email string, topicIDs []ente.TopicID) error
+	// Unsubscribe removes email from the provider's mailing list(s)
+	// entirely, i.e. from every topic.
+	//
+	// Implementations should treat the address already being absent (e.g.
+	// Zoho's "Contact does not exist", returned after a customer erases
+	// their data) as success rather than an error.
+	Unsubscribe(email string) error
+	// ListTopics returns the topics that customers can independently
+	// subscribe to.
+	ListTopics() ([]ente.Topic, error)
+}
+
 // MailingListsController is used to keeping the external mailing lists in sync
 // with customer email changes.
 //
 // MailingListsController contains methods for keeping external mailing lists in
 // sync when new users sign up, or update their email, or delete their account.
-// Currently, these mailing lists are hosted on Zoho Campaigns.
+//
+// It does not talk to any particular provider directly - instead it delegates
+// to a MailingListProvider, the concrete implementation of which is chosen via
+// the `mailing_lists.provider` config (zoho, mailgun, listmonk or log), so
+// operators aren't locked into any one mailing list vendor.
+//
+// Subscribe/Unsubscribe/UpdateEmail do not call the provider inline - they
+// enqueue a row onto the `mailing_list_ops` outbox and return immediately, so
+// a Zoho (or other provider) outage never blocks the signup/deletion/
+// email-change flow that triggered them. RunOutboxWorker is what actually
+// drains the outbox, retrying failures with backoff.
 //
 // See also: Syncing emails with Zoho Campaigns
 type MailingListsController struct {
-	zohoAccessToken string
-	zohoListKey     string
-	zohoTopicIds    string
-	zohoCredentials zoho.Credentials
+	provider     MailingListProvider
+	providerName string
+	// providers caches a MailingListProvider per provider name, so that an
+	// outbox op recorded against a provider other than the current
+	// `mailing_lists.provider` (see MailingListOp.Provider) can still be
+	// replayed against the backend it was actually meant for, instead of
+	// whatever the operator has since switched to.
+	providers             map[string]MailingListProvider
+	Repo                  *repo.MailingListOpsRepository
+	UnsubscribeEventsRepo *repo.MailingListUnsubscribeEventsRepository
+	UserEmailPreferences  *repo.UserEmailPreferencesRepository
+	UserRepo              *repo.UserRepository
 }
 
 // Return a new instance of MailingListsController
-func NewMailingListsController() *MailingListsController {
+func NewMailingListsController(db *sql.DB, userRepo *repo.UserRepository) *MailingListsController {
+	providerName := viper.GetString("mailing_lists.provider")
+	if providerName == "" {
+		providerName = "zoho"
+	}
+	provider := newProviderNamed(providerName)
+	return &MailingListsController{
+		provider:              provider,
+		providerName:          providerName,
+		providers:             map[string]MailingListProvider{providerName: provider},
+		Repo:                  &repo.MailingListOpsRepository{DB: db},
+		UnsubscribeEventsRepo: &repo.MailingListUnsubscribeEventsRepository{DB: db},
+		UserEmailPreferences:  &repo.UserEmailPreferencesRepository{DB: db},
+		UserRepo:              userRepo,
+	}
+}
+
+// providerFor returns the MailingListProvider that an outbox op recorded
+// against providerName should be replayed through, building (and caching) it
+// on first use. An empty providerName (an op enqueued before this field
+// existed) falls back to the controller's current default provider.
+func (c *MailingListsController) providerFor(providerName string) MailingListProvider {
+	if providerName == "" {
+		return c.provider
+	}
+	if p, ok := c.providers[providerName]; ok {
+		return p
+	}
+	p := newProviderNamed(providerName)
+	c.providers[providerName] = p
+	return p
+}
+
+func newProviderNamed(providerName string) MailingListProvider {
+	switch providerName {
+	case "mailgun":
+		return mailgun.NewMailingListProvider(
+			viper.GetString("mailgun.api-key"),
+			viper.GetString("mailgun.list-address"),
+			viper.GetString("mailgun.base-url"),
+		)
+	case "listmonk":
+		return listmonk.NewMailingListProvider(
+			viper.GetString("listmonk.base-url"),
+			viper.GetString("listmonk.username"),
+			viper.GetString("listmonk.password"),
+			viper.GetIntSlice("listmonk.list-ids"),
+		)
+	case "log":
+		return logmailer.NewMailingListProvider()
+	case "zoho", "":
+		// Zoho is the default provider, to preserve existing behaviour for
+		// deployments that have not set `mailing_lists.provider` explicitly.
+		return newZohoProvider()
+	default:
+		log.Errorf("Unknown mailing_lists.provider %q, falling back to Zoho", providerName)
+		return newZohoProvider()
+	}
+}
+
+func newZohoProvider() MailingListProvider {
 	zohoCredentials := zoho.Credentials{
 		ClientID:     viper.GetString("zoho.client-id"),
 		ClientSecret: viper.GetString("zoho.client-secret"),
@@ -57,104 +166,96 @@ func NewMailingListsController() *MailingListsController {
 	// we'll use the refresh token to create an access token on demand.
 	zohoAccessToken := viper.GetString("zoho.access_token")
 
-	return &MailingListsController{
-		zohoCredentials: zohoCredentials,
-		zohoListKey:     zohoListKey,
-		zohoTopicIds:    zohoTopicIds,
-		zohoAccessToken: zohoAccessToken,
-	}
+	return zoho.NewMailingListProvider(zohoListKey, zohoTopicIds, zohoAccessToken, zohoCredentials)
 }
 
-// Add the given email address to our default Zoho Campaigns list.
+// Subscribe enqueues userID's email address to be added to the configured
+// mailing list provider, respecting whatever per-topic preferences they've
+// previously set (see SetSubscriptions) - a user who has never set any
+// preferences is subscribed to every topic, which is the behaviour this
+// replaced.
 //
-// It is valid to resubscribe an email that has previously been unsubscribe.
-//
-// # Syncing emails with Zoho Campaigns
-//
-// Zoho Campaigns does not support maintaining a list of raw email addresses
-// that can be later updated or deleted via their API. So instead, we maintain
-// the email addresses of our customers in a Zoho Campaign "list", and subscribe
-// or unsubscribe them to this list.
-func (c *MailingListsController) Subscribe(email string) error {
-	if c.shouldSkip() {
-		return stacktrace.Propagate(ente.ErrNotImplemented, "")
-	}
-
-	// Need to set "Signup Form Disabled" in the list settings since we use this
-	// list to keep track of emails that have already been verified.
-	//
-	// > You can use this API to add contacts to your mailing lists. For signup
-	//   form enabled mailing lists, the contacts will receive a confirmation
-	//   email. For signup form disabled lists, contacts will be added without
-	//   any confirmations.
-	//
-	// https://www.zoho.com/campaigns/help/developers/contact-subscribe.html
-	return c.doListAction("listsubscribe", email)
+// It is valid to resubscribe an email that has previously been unsubscribed.
+func (c *MailingListsController) Subscribe(userID int64, email string) error {
+	return stacktrace.Propagate(c.Repo.Enqueue(ente.MailingListOpSubscribe, c.providerName, userID, email, "", nil, false, nowMicro()), "")
 }
 
-// Unsubscribe the given email address to our default Zoho Campaigns list.
-//
-// See: [Note: Syncing emails with Zoho Campaigns]
+// Unsubscribe enqueues the given email address to be removed from the
+// configured mailing list provider, from every topic.
 func (c *MailingListsController) Unsubscribe(email string) error {
-	if c.shouldSkip() {
-		return stacktrace.Propagate(ente.ErrNotImplemented, "")
-	}
+	return stacktrace.Propagate(c.Repo.Enqueue(ente.MailingListOpUnsubscribe, c.providerName, 0, email, "", nil, false, nowMicro()), "")
+}
 
-	// https://www.zoho.com/campaigns/help/developers/contact-unsubscribe.html
-	return c.doListAction("listunsubscribe", email)
+// ListTopics returns the topics that customers can independently subscribe
+// to, e.g. to render a `/users/me/email-preferences` preferences pane.
+func (c *MailingListsController) ListTopics() ([]ente.Topic, error) {
+	topics, err := c.provider.ListTopics()
+	return topics, stacktrace.Propagate(err, "")
 }
 
-func (c *MailingListsController) shouldSkip() bool {
-	if c.zohoCredentials.RefreshToken == "" {
-		log.Info("Skipping mailing list update because credentials are not configured")
-		return true
+// GetSubscriptions returns the topics userID is currently subscribed to.
+func (c *MailingListsController) GetSubscriptions(userID int64) ([]ente.TopicID, error) {
+	allTopics, err := c.provider.ListTopics()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "")
 	}
-	return false
+	topicIDs, _, err := c.UserEmailPreferences.GetSubscribedTopics(userID, allTopics)
+	return topicIDs, stacktrace.Propagate(err, "")
 }
 
-// Both the listsubscribe and listunsubscribe Zoho Campaigns API endpoints work
-// similarly, so use this function to keep the common code.
-func (c *MailingListsController) doListAction(action string, email string) error {
-	// Query escape the email so that any pluses get converted to %2B.
-	escapedEmail := url.QueryEscape(email)
-	contactInfo := fmt.Sprintf("{Contact+Email: \"%s\"}", escapedEmail)
-	// Instead of using QueryEscape, use PathEscape. QueryEscape escapes the "+"
-	// character, which causes Zoho API to not recognize the parameter.
-	escapedContactInfo := url.PathEscape(contactInfo)
-
-	url := fmt.Sprintf(
-		"https://campaigns.zoho.com/api/v1.1/json/%s?resfmt=JSON&listkey=%s&contactinfo=%s&topic_id=%s",
-		action, c.zohoListKey, escapedContactInfo, c.zohoTopicIds)
-
-	zohoAccessToken, err := zoho.DoRequest("POST", url, c.zohoAccessToken, c.zohoCredentials)
-	c.zohoAccessToken = zohoAccessToken
+// SetSubscriptions stores userID's choice of topics and enqueues a
+// resubscribe against the provider so the new choice takes effect there too.
+func (c *MailingListsController) SetSubscriptions(userID int64, topicIDs []ente.TopicID) error {
+	allTopics, err := c.provider.ListTopics()
+	if err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+	if err := c.UserEmailPreferences.SetSubscribedTopics(userID, allTopics, topicIDs, nowMicro()); err != nil {
+		return stacktrace.Propagate(err, "")
+	}
 
+	email, err := c.UserRepo.GetEmailByID(userID)
+	if err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+	// Re-derive the topics to enqueue from GetSubscribedTopics rather than
+	// passing through the client-supplied topicIDs verbatim - the latter may
+	// contain IDs that SetSubscribedTopics silently dropped (not in
+	// allTopics) or that aren't valid provider list IDs at all, which would
+	// otherwise dead-letter this op even though what we actually persisted
+	// was fine. hasTopicSelection is always true here, even if persisted is
+	// empty, since the user explicitly chose that selection just now - it
+	// must not be mistaken for "no preference recorded" at delivery time.
+	persisted, _, err := c.UserEmailPreferences.GetSubscribedTopics(userID, allTopics)
 	if err != nil {
-		// This is not necessarily an error, and can happen when the customer
-		// had earlier unsubscribed from our organization emails in Zoho,
-		// selecting the "Erase my data" option. This causes Zoho to remove the
-		// customer's entire record from their database.
-		//
-		// Then later, say if the customer deletes their account from ente, we
-		// would try to unsubscribe their email but it wouldn't be present in
-		// Zoho, and this API call would've failed.
-		//
-		// In such a case, Zoho will return the following response:
-		//
-		//   { code":"2103",
-		//     "message":"Contact does not exist.",
-		//     "version":"1.1",
-		//     "uri":"/api/v1.1/json/listunsubscribe",
-		//     "status":"error"}
-		//
-		// Special case these to reduce the severity level so as to not cause
-		// error log spam.
-		if strings.Contains(err.Error(), "Contact does not exist") {
-			log.Warnf("Zoho - Could not %s '%s': %s", action, email, err)
-		} else {
-			log.Errorf("Zoho - Could not %s '%s': %s", action, email, err)
-		}
+		return stacktrace.Propagate(err, "")
 	}
+	return stacktrace.Propagate(c.Repo.Enqueue(ente.MailingListOpSubscribe, c.providerName, userID, email, "", persisted, true, nowMicro()), "")
+}
+
+// UpdateEmail enqueues a migration of userID's mailing list subscriptions
+// from oldEmail to newEmail, so that e.g. changing your ente account email
+// doesn't silently drop you from lists you'd opted into.
+//
+// This is enqueued as a single MailingListOpUpdateEmail rather than a
+// separate unsubscribe+subscribe pair, since doing those as independent ops
+// would race against each other under retry (and could leave a customer
+// subscribed under both addresses, or neither, if the worker crashed
+// between them).
+//
+// UpdateEmail itself is called from WebhooksController's built-in
+// ente.EventUserEmailChanged handler (see NewWebhooksController), not
+// directly from the account email-change code - that keeps this controller
+// unaware of how "email changed" gets decided, the same way Subscribe and
+// Unsubscribe are driven by EventUserCreated/EventUserDeleted rather than
+// being called inline from account code.
+func (c *MailingListsController) UpdateEmail(userID int64, oldEmail string, newEmail string) error {
+	return stacktrace.Propagate(c.Repo.Enqueue(ente.MailingListOpUpdateEmail, c.providerName, userID, oldEmail, newEmail, nil, false, nowMicro()), "")
+}
 
-	return stacktrace.Propagate(err, "")
+// ReplayDeadLettered moves a dead-lettered outbox row back to pending so
+// RunOutboxWorker picks it up again on its next poll. Used by the admin
+// endpoint for manually recovering ops that exhausted their retries.
+func (c *MailingListsController) ReplayDeadLettered(id int64) error {
+	return stacktrace.Propagate(c.Repo.Requeue(id, nowMicro()), "")
 }
@@ -0,0 +1,21 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	webhookOutboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "webhook_outbox_pending",
+		Help: "Number of webhook deliveries currently due to be sent, counted up to one more than the per-poll batch size",
+	})
+	webhookOutboxFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "webhook_outbox_failures_total",
+		Help: "Number of webhook delivery attempts that failed",
+	})
+	webhookOutboxDeadLettered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "webhook_outbox_dead_lettered_total",
+		Help: "Number of webhook deliveries that exhausted their retries",
+	})
+)
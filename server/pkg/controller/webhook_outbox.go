@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ente-io/museum/ente"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// webhookOutboxMaxAttempts is the number of times we retry a delivery
+	// before giving up on it and dead-lettering it instead.
+	webhookOutboxMaxAttempts = 8
+	// webhookOutboxPollInterval is how often the worker checks for
+	// deliveries that are due to be (re)attempted.
+	webhookOutboxPollInterval = 10 * time.Second
+	// webhookOutboxBatchSize bounds how many deliveries we pull per poll, so
+	// a large backlog doesn't monopolize the worker's time.
+	webhookOutboxBatchSize = 50
+	// webhookDeliveryTimeout bounds how long we wait for a subscriber to
+	// respond, so that a hung or slow subscriber can't stall the
+	// single-goroutine outbox worker (and therefore every other pending
+	// delivery) for the length of the OS-level TCP timeout.
+	webhookDeliveryTimeout = 15 * time.Second
+)
+
+var webhookHTTPClient = &http.Client{Timeout: webhookDeliveryTimeout}
+
+// RunOutboxWorker polls the webhook_deliveries outbox and replays pending
+// deliveries against their subscribers, retrying with exponential backoff
+// and jitter on failure. It blocks, so callers should run it in its own
+// goroutine, e.g.
+//
+//	go webhooksController.RunOutboxWorker(stop)
+//
+// This is what lets Publish enqueue an HTTP delivery and return immediately
+// - a subscriber being slow or down delays delivery instead of failing the
+// signup/deletion/email-change request that triggered it.
+func (c *WebhooksController) RunOutboxWorker(stop <-chan struct{}) {
+	ticker := time.NewTicker(webhookOutboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.processDueDeliveries()
+		}
+	}
+}
+
+func (c *WebhooksController) processDueDeliveries() {
+	now := nowMicro()
+	deliveries, err := c.Repo.GetDueOps(now, webhookOutboxBatchSize)
+	if err != nil {
+		log.Errorf("Webhook outbox - could not fetch due deliveries: %s", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		c.processDelivery(delivery)
+	}
+
+	if pending, err := c.Repo.GetDueOps(now, webhookOutboxBatchSize+1); err == nil {
+		webhookOutboxPending.Set(float64(len(pending)))
+	}
+}
+
+func (c *WebhooksController) processDelivery(delivery ente.WebhookDelivery) {
+	err := deliverWebhook(delivery)
+
+	now := nowMicro()
+	if err == nil {
+		if markErr := c.Repo.MarkSucceeded(delivery.ID, now); markErr != nil {
+			log.Errorf("Webhook outbox - could not mark delivery %d as succeeded: %s", delivery.ID, markErr)
+		}
+		return
+	}
+
+	webhookOutboxFailures.Inc()
+	attemptCount := delivery.AttemptCount + 1
+	nextAttemptAt := now + backoffWithJitter(attemptCount).Microseconds()
+	if markErr := c.Repo.MarkFailed(delivery.ID, attemptCount, webhookOutboxMaxAttempts, err.Error(), nextAttemptAt, now); markErr != nil {
+		log.Errorf("Webhook outbox - could not mark delivery %d as failed: %s", delivery.ID, markErr)
+	}
+	if attemptCount >= webhookOutboxMaxAttempts {
+		webhookOutboxDeadLettered.Inc()
+		log.Errorf("Webhook outbox - delivery %d to '%s' dead-lettered after %d attempts: %s", delivery.ID, delivery.Target, attemptCount, err)
+	} else {
+		log.Warnf("Webhook outbox - delivery %d to '%s' failed (attempt %d): %s", delivery.ID, delivery.Target, attemptCount, err)
+	}
+}
+
+// deliverWebhook POSTs delivery.Payload to delivery.Target, signing the body
+// with delivery.Secret so the subscriber can verify it actually came from
+// us.
+func deliverWebhook(delivery ente.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.Target, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ente-Signature", signWebhookPayload(delivery.Payload, delivery.Secret))
+
+	res, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook subscriber returned %d", res.StatusCode)
+	}
+	return nil
+}
+
+// signWebhookPayload returns the hex-encoded HMAC-SHA256 of payload, keyed
+// with secret, for use in the X-Ente-Signature header - this is what lets a
+// subscriber verify that a delivery actually came from us and wasn't
+// forged or tampered with in transit.
+func signWebhookPayload(payload string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
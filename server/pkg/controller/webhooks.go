@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"text/template"
+
+	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/museum/pkg/repo"
+	"github.com/ente-io/stacktrace"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// webhookSubscriptionConfig is the YAML shape of one entry under the
+// `webhooks.subscriptions` config key, e.g.
+//
+//	webhooks:
+//	  subscriptions:
+//	    - for: ["user.created", "user.deleted"]
+//	      target: "https://crm.example.org/ente-hook"
+//	      secret: "..."
+//	    - for: ["subscription.changed"]
+//	      when: "{{if eq .PlanID \"pro\"}}true{{end}}"
+//	      target: "https://analytics.example.org/ente-hook"
+//	      secret: "..."
+//
+// This is what lets third parties (analytics, a CRM, a self-hosted Mailman
+// instance) register themselves as subscribers without patching museum.
+type webhookSubscriptionConfig struct {
+	For    []ente.EventType `mapstructure:"for"`
+	When   string           `mapstructure:"when"`
+	Target string           `mapstructure:"target"`
+	Secret string           `mapstructure:"secret"`
+}
+
+// matches reports whether event should be delivered to this subscription.
+func (s webhookSubscriptionConfig) matches(event ente.Event) bool {
+	forThisEvent := false
+	for _, eventType := range s.For {
+		if eventType == event.Type {
+			forThisEvent = true
+			break
+		}
+	}
+	if !forThisEvent {
+		return false
+	}
+	if s.When == "" {
+		return true
+	}
+	return evaluateWhen(s.When, event)
+}
+
+// evaluateWhen renders the `when` template against event, treating the
+// literal output "true" as a match - this keeps the condition language to
+// something we already depend on (text/template) rather than pulling in a
+// dedicated expression evaluator for what is, so far, a rarely used filter.
+func evaluateWhen(when string, event ente.Event) bool {
+	tmpl, err := template.New("when").Parse(when)
+	if err != nil {
+		log.Errorf("Invalid webhook `when` template %q, treating as no match: %s", when, err)
+		return false
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, event); err != nil {
+		log.Errorf("Could not evaluate webhook `when` template %q, treating as no match: %s", when, err)
+		return false
+	}
+	return out.String() == "true"
+}
+
+// webhookHandler is an in-process subscriber - used for built-in
+// subscribers (like MailingListsController) that don't need the overhead of
+// an HTTP round trip just to talk to another part of museum itself.
+type webhookHandler func(event ente.Event) error
+
+// WebhooksController fans account lifecycle events (user signup, email
+// change, deletion, subscription change, ...) out to subscribers - both
+// in-process handlers registered directly in Go, and third-party HTTP
+// targets configured in YAML under `webhooks.subscriptions` - generalizing
+// what used to be a hardcoded "notify Zoho" call at each of these call
+// sites.
+//
+// HTTP deliveries do not happen inline - Publish enqueues them onto the
+// `webhook_deliveries` outbox, and RunOutboxWorker drains it with retries,
+// so a slow or down subscriber can never block or lose the event that
+// triggered it. In-process handlers are called inline, since they're
+// expected to already be cheap outbox enqueues of their own (e.g.
+// MailingListsController.Subscribe).
+//
+// Callers: the account signup, email-change and deletion handlers should
+// call Publish with the corresponding ente.Event once they've committed
+// their own change, the same way they used to call MailingListsController's
+// methods directly before this subscriber list existed.
+//
+// Those handlers are not part of this checkout - this package is a
+// standalone slice of museum covering only the mailing-list/webhooks
+// subsystem (confirmed: no UserController, UserRepository implementation or
+// account signup/deletion/email-change code exists anywhere under pkg/ here).
+// Wiring the three Publish calls above into those handlers is tracked as a
+// follow-up against that part of the codebase, not against this one -
+// TestPublishContinuesPastFailingHandler in webhooks_test.go pins the part of
+// the contract those callers rely on that one failing subscriber can't take
+// the others down with it; which handlers get registered is not tested.
+type WebhooksController struct {
+	handlers      map[ente.EventType][]webhookHandler
+	subscriptions []webhookSubscriptionConfig
+	Repo          *repo.WebhookDeliveriesRepository
+}
+
+// NewWebhooksController returns a WebhooksController with mlController
+// registered as the built-in subscriber for the account lifecycle events it
+// cares about, plus whatever third-party HTTP subscriptions are configured
+// under `webhooks.subscriptions`.
+func NewWebhooksController(db *sql.DB, mlController *MailingListsController) *WebhooksController {
+	c := &WebhooksController{
+		handlers: make(map[ente.EventType][]webhookHandler),
+		Repo:     &repo.WebhookDeliveriesRepository{DB: db},
+	}
+
+	c.RegisterHandler(ente.EventUserCreated, func(event ente.Event) error {
+		return mlController.Subscribe(event.UserID, event.Email)
+	})
+	c.RegisterHandler(ente.EventUserEmailChanged, func(event ente.Event) error {
+		return mlController.UpdateEmail(event.UserID, event.Email, event.NewEmail)
+	})
+	c.RegisterHandler(ente.EventUserDeleted, func(event ente.Event) error {
+		return mlController.Unsubscribe(event.Email)
+	})
+
+	var subscriptions []webhookSubscriptionConfig
+	if err := viper.UnmarshalKey("webhooks.subscriptions", &subscriptions); err != nil {
+		log.Errorf("Could not parse webhooks.subscriptions, ignoring: %s", err)
+	} else {
+		c.subscriptions = subscriptions
+	}
+
+	return c
+}
+
+// RegisterHandler adds an in-process subscriber for eventType, called
+// synchronously from Publish. Third parties should use an HTTP subscription
+// (configured under `webhooks.subscriptions`) instead, so their deliveries
+// get retries independent of the request that triggered them.
+func (c *WebhooksController) RegisterHandler(eventType ente.EventType, handler webhookHandler) {
+	c.handlers[eventType] = append(c.handlers[eventType], handler)
+}
+
+// Publish notifies every subscriber - in-process and HTTP - registered for
+// event.Type.
+//
+// A failing in-process handler does not stop the others from running, nor
+// does it skip the HTTP subscriptions below - otherwise, say, a transient DB
+// error from the mailing-list handler would silently prevent every other
+// built-in and third-party subscriber from ever hearing about the event,
+// which is exactly the single point of failure this generalized subscriber
+// list was meant to remove. Each failure is logged and Publish itself never
+// fails because of one.
+func (c *WebhooksController) Publish(event ente.Event) {
+	for _, handler := range c.handlers[event.Type] {
+		if err := handler(event); err != nil {
+			log.Errorf("Webhook handler for %s failed, continuing with remaining subscribers: %s", event.Type, err)
+		}
+	}
+
+	var payload []byte
+	var payloadErr error
+	for _, sub := range c.subscriptions {
+		if !sub.matches(event) {
+			continue
+		}
+		if payload == nil && payloadErr == nil {
+			payload, payloadErr = json.Marshal(event)
+			if payloadErr != nil {
+				log.Errorf("Could not marshal %s event, skipping HTTP subscriptions: %s", event.Type, payloadErr)
+			}
+		}
+		if payloadErr != nil {
+			continue
+		}
+		if err := c.Repo.Enqueue(event.Type, string(payload), sub.Target, sub.Secret, nowMicro()); err != nil {
+			log.Errorf("Could not enqueue webhook delivery to '%s' for %s: %s", sub.Target, event.Type, err)
+		}
+	}
+}
+
+// ReplayDeadLettered moves a dead-lettered delivery back to pending so
+// RunOutboxWorker picks it up again on its next poll. Used by the admin
+// endpoint for manually recovering deliveries that exhausted their retries.
+func (c *WebhooksController) ReplayDeadLettered(id int64) error {
+	return stacktrace.Propagate(c.Repo.Requeue(id, nowMicro()), "")
+}
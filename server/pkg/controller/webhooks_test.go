@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ente-io/museum/ente"
+)
+
+// TestPublishContinuesPastFailingHandler guards the exact regression fixed
+// earlier in this series: a failing in-process handler must not prevent
+// Publish from notifying the remaining subscribers for the same event.
+func TestPublishContinuesPastFailingHandler(t *testing.T) {
+	c := &WebhooksController{handlers: make(map[ente.EventType][]webhookHandler)}
+
+	var secondCalled bool
+	c.RegisterHandler(ente.EventUserCreated, func(event ente.Event) error {
+		return errors.New("boom")
+	})
+	c.RegisterHandler(ente.EventUserCreated, func(event ente.Event) error {
+		secondCalled = true
+		return nil
+	})
+
+	c.Publish(ente.Event{Type: ente.EventUserCreated, UserID: 1, Email: "user@example.com"})
+
+	if !secondCalled {
+		t.Fatal("second handler was not called after the first one failed")
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	sig := signWebhookPayload(`{"type":"user.created"}`, "s3cr3t")
+	if sig == "" {
+		t.Fatal("expected a non-empty signature")
+	}
+	if sig != signWebhookPayload(`{"type":"user.created"}`, "s3cr3t") {
+		t.Fatal("signing the same payload and secret twice should be deterministic")
+	}
+	if sig == signWebhookPayload(`{"type":"user.created"}`, "different") {
+		t.Fatal("signatures for different secrets should not collide")
+	}
+}
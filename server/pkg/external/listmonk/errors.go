@@ -0,0 +1,7 @@
+package listmonk
+
+import "errors"
+
+// ErrNotConfigured is returned when the self-hosted instance's base URL has
+// not been set, so there's nothing for us to talk to.
+var ErrNotConfigured = errors.New("listmonk is not configured")
@@ -0,0 +1,193 @@
+// Package listmonk implements a MailingListProvider for self-hosted mailing
+// list software that exposes a Listmonk or Mailman3 style REST API - a POST
+// to add a subscriber (with a pre_confirmed/pre_verified flag so that no
+// double opt-in email is sent, since ente only lists users who have already
+// verified their email with us) and a DELETE to remove one.
+package listmonk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/stacktrace"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestTimeout bounds how long we wait for the self-hosted instance to
+// respond, so that a hung or slow request can't stall the single-goroutine
+// outbox worker (and therefore every other pending op) for the length of the
+// OS-level TCP timeout.
+const requestTimeout = 15 * time.Second
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+// MailingListProvider keeps a self-hosted Listmonk or Mailman3 list in sync
+// with our customers' email addresses.
+type MailingListProvider struct {
+	// baseURL is the root of the instance's API, e.g.
+	// "https://lists.example.org/api".
+	baseURL string
+	// username and password are used for HTTP basic auth against the
+	// instance's admin API.
+	username string
+	password string
+	// listIDs are the IDs of the lists that a subscriber should be added to.
+	listIDs []int
+}
+
+// NewMailingListProvider returns a Listmonk/Mailman3 backed implementation
+// of the MailingListProvider interface used by the MailingListsController.
+func NewMailingListProvider(baseURL string, username string, password string, listIDs []int) *MailingListProvider {
+	return &MailingListProvider{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		listIDs:  listIDs,
+	}
+}
+
+type subscriberRequest struct {
+	Email          string         `json:"email"`
+	Name           string         `json:"name"`
+	Status         string         `json:"status"`
+	Lists          []int          `json:"lists"`
+	PreConfirmSubs bool           `json:"preconfirm_subscriptions"`
+	Attribs        map[string]any `json:"attribs,omitempty"`
+}
+
+// Subscribe adds the given email address as a pre-confirmed member of the
+// configured lists.
+//
+// If topicIDs is non-empty, the subscriber is only added to those lists
+// instead of the configured default set - topicIDs are the string forms of
+// Listmonk/Mailman3 list IDs.
+func (p *MailingListProvider) Subscribe(email string, topicIDs []ente.TopicID) error {
+	if p.shouldSkip() {
+		return stacktrace.Propagate(ErrNotConfigured, "")
+	}
+
+	listIDs := p.listIDs
+	if len(topicIDs) > 0 {
+		var err error
+		listIDs, err = parseListIDs(topicIDs)
+		if err != nil {
+			return stacktrace.Propagate(err, "")
+		}
+	}
+
+	body := subscriberRequest{
+		Email:          email,
+		Name:           email,
+		Status:         "enabled",
+		Lists:          listIDs,
+		PreConfirmSubs: true,
+	}
+	return stacktrace.Propagate(p.doRequest(http.MethodPost, p.baseURL+"/subscribers", body), "")
+}
+
+// Unsubscribe removes the given email address from the instance.
+func (p *MailingListProvider) Unsubscribe(email string) error {
+	if p.shouldSkip() {
+		return stacktrace.Propagate(ErrNotConfigured, "")
+	}
+
+	reqURL := fmt.Sprintf("%s/subscribers/query/delete?query=%s", p.baseURL,
+		url.QueryEscape(fmt.Sprintf("subscribers.email = '%s'", escapeSQLLiteral(email))))
+	err := p.doRequest(http.MethodDelete, reqURL, nil)
+	if err != nil && isNotFound(err) {
+		log.Warnf("Listmonk - '%s' was not a subscriber: %s", email, err)
+		return nil
+	}
+	return stacktrace.Propagate(err, "")
+}
+
+// ListTopics returns the configured list IDs, stringified, since Listmonk
+// and Mailman3 both call the equivalent concept a "list" rather than a
+// "topic". We don't have human-readable names for them, so the ID doubles
+// as the name.
+func (p *MailingListProvider) ListTopics() ([]ente.Topic, error) {
+	topics := make([]ente.Topic, len(p.listIDs))
+	for i, id := range p.listIDs {
+		idStr := strconv.Itoa(id)
+		topics[i] = ente.Topic{ID: ente.TopicID(idStr), Name: idStr}
+	}
+	return topics, nil
+}
+
+func parseListIDs(topicIDs []ente.TopicID) ([]int, error) {
+	listIDs := make([]int, len(topicIDs))
+	for i, id := range topicIDs {
+		parsed, err := strconv.Atoi(string(id))
+		if err != nil {
+			return nil, err
+		}
+		listIDs[i] = parsed
+	}
+	return listIDs, nil
+}
+
+func (p *MailingListProvider) shouldSkip() bool {
+	if p.baseURL == "" {
+		log.Info("Skipping self-hosted mailing list update because the instance URL is not configured")
+		return true
+	}
+	return false
+}
+
+func (p *MailingListProvider) doRequest(method string, reqURL string, payload any) error {
+	var reqBody *bytes.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return stacktrace.Propagate(err, "")
+		}
+		reqBody = bytes.NewReader(encoded)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, reqURL, reqBody)
+	if err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var parsed struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&parsed)
+		return stacktrace.Propagate(fmt.Errorf("listmonk: %d %s", res.StatusCode, parsed.Message), "")
+	}
+
+	return nil
+}
+
+// escapeSQLLiteral escapes single quotes in s so it can be safely embedded
+// inside a single-quoted SQL string literal. Listmonk's delete-by-query
+// endpoint takes a raw SQL WHERE clause rather than parameterized values, so
+// this is the only thing standing between an email address containing a
+// quote and arbitrary SQL injection against the self-hosted instance.
+func escapeSQLLiteral(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+func isNotFound(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "no subscriber"))
+}
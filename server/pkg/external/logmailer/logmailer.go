@@ -0,0 +1,41 @@
+// Package logmailer implements a MailingListProvider that just logs what it
+// would have done, modelled on the mediocregopher project's `logMailer` -
+// useful for local development and tests, where we don't want to (or can't)
+// talk to a real mailing list provider.
+package logmailer
+
+import (
+	"github.com/ente-io/museum/ente"
+	log "github.com/sirupsen/logrus"
+)
+
+// MailingListProvider logs subscribe/unsubscribe actions instead of
+// forwarding them to an external service.
+type MailingListProvider struct{}
+
+// NewMailingListProvider returns a no-op MailingListProvider that logs the
+// actions it would otherwise have performed.
+func NewMailingListProvider() *MailingListProvider {
+	return &MailingListProvider{}
+}
+
+// Subscribe logs that email would have been subscribed.
+func (p *MailingListProvider) Subscribe(email string, topicIDs []ente.TopicID) error {
+	if len(topicIDs) > 0 {
+		log.Infof("logmailer - would subscribe '%s' to topics %v", email, topicIDs)
+	} else {
+		log.Infof("logmailer - would subscribe '%s'", email)
+	}
+	return nil
+}
+
+// Unsubscribe logs that email would have been unsubscribed.
+func (p *MailingListProvider) Unsubscribe(email string) error {
+	log.Infof("logmailer - would unsubscribe '%s'", email)
+	return nil
+}
+
+// ListTopics returns no topics, since there is nothing to subscribe to.
+func (p *MailingListProvider) ListTopics() ([]ente.Topic, error) {
+	return nil, nil
+}
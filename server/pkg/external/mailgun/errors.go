@@ -0,0 +1,7 @@
+package mailgun
+
+import "errors"
+
+// ErrNotConfigured is returned when the Mailgun API key or mailing list
+// address have not been set, so there's nothing for us to talk to.
+var ErrNotConfigured = errors.New("mailgun is not configured")
@@ -0,0 +1,152 @@
+// Package mailgun implements a MailingListProvider backed by Mailgun's
+// mailing list API.
+//
+// https://documentation.mailgun.com/en/latest/api-mailinglists.html
+package mailgun
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/stacktrace"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestTimeout bounds how long we wait for Mailgun to respond, so that a
+// hung or slow request can't stall the single-goroutine outbox worker (and
+// therefore every other pending op) for the length of the OS-level TCP
+// timeout.
+const requestTimeout = 15 * time.Second
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+// MailingListProvider keeps a Mailgun mailing list in sync with our
+// customers' email addresses.
+type MailingListProvider struct {
+	// apiKey is the Mailgun private API key, used as the password in the
+	// request's HTTP basic auth (the username is always "api").
+	apiKey string
+	// listAddress is the address of the Mailgun mailing list, e.g.
+	// "updates@mg.example.org".
+	listAddress string
+	// baseURL allows overriding the Mailgun API host, e.g. to use the EU
+	// region ("https://api.eu.mailgun.net/v3") instead of the default US one.
+	baseURL string
+}
+
+// NewMailingListProvider returns a Mailgun backed implementation of the
+// MailingListProvider interface used by the MailingListsController.
+func NewMailingListProvider(apiKey string, listAddress string, baseURL string) *MailingListProvider {
+	if baseURL == "" {
+		baseURL = "https://api.mailgun.net/v3"
+	}
+	return &MailingListProvider{
+		apiKey:      apiKey,
+		listAddress: listAddress,
+		baseURL:     baseURL,
+	}
+}
+
+// Subscribe adds the given email address as a subscribed member of our
+// Mailgun mailing list.
+//
+// Mailgun does not have a first class concept of topics within a mailing
+// list, so if topicIDs is given we stash it as a "topics" tag in the
+// member's `vars`, which is the closest approximation Mailgun offers.
+func (p *MailingListProvider) Subscribe(email string, topicIDs []ente.TopicID) error {
+	if p.shouldSkip() {
+		return stacktrace.Propagate(ErrNotConfigured, "")
+	}
+
+	form := url.Values{}
+	form.Set("address", email)
+	form.Set("subscribed", "yes")
+	form.Set("upsert", "yes")
+	if len(topicIDs) > 0 {
+		vars, err := json.Marshal(map[string][]ente.TopicID{"topics": topicIDs})
+		if err != nil {
+			return stacktrace.Propagate(err, "")
+		}
+		form.Set("vars", string(vars))
+	}
+
+	reqURL := fmt.Sprintf("%s/lists/%s/members", p.baseURL, p.listAddress)
+	return stacktrace.Propagate(p.doRequest(http.MethodPost, reqURL, form), "")
+}
+
+// Unsubscribe removes the given email address from our Mailgun mailing list.
+//
+// Mailgun returns a 404 if the member does not already exist; we treat that
+// the same way we treat Zoho's "Contact does not exist" - as a no-op rather
+// than a hard failure, since it just means there was nothing to undo.
+func (p *MailingListProvider) Unsubscribe(email string) error {
+	if p.shouldSkip() {
+		return stacktrace.Propagate(ErrNotConfigured, "")
+	}
+
+	reqURL := fmt.Sprintf("%s/lists/%s/members/%s", p.baseURL, p.listAddress, url.PathEscape(email))
+	err := p.doRequest(http.MethodDelete, reqURL, nil)
+	if err != nil && strings.Contains(err.Error(), "404") {
+		log.Warnf("Mailgun - '%s' was not a member of the list: %s", email, err)
+		return nil
+	}
+	return stacktrace.Propagate(err, "")
+}
+
+// ListTopics returns the topics that members of our mailing list can be
+// filtered by.
+//
+// Since Mailgun has no native notion of topics, these are just the tags we
+// ourselves choose to stash in each member's `vars.topics` - there is
+// nothing to list until the operator configures some, so this returns an
+// empty list for now.
+func (p *MailingListProvider) ListTopics() ([]ente.Topic, error) {
+	return nil, nil
+}
+
+func (p *MailingListProvider) shouldSkip() bool {
+	if p.apiKey == "" || p.listAddress == "" {
+		log.Info("Skipping Mailgun mailing list update because credentials are not configured")
+		return true
+	}
+	return false
+}
+
+func (p *MailingListProvider) doRequest(method string, reqURL string, form url.Values) error {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+
+	req, err := http.NewRequest(method, reqURL, body)
+	if err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+	req.SetBasicAuth("api", p.apiKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var parsed struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&parsed)
+		return stacktrace.Propagate(fmt.Errorf("mailgun: %d %s", res.StatusCode, parsed.Message), "")
+	}
+
+	return nil
+}
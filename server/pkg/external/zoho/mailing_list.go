@@ -0,0 +1,176 @@
+package zoho
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/stacktrace"
+	log "github.com/sirupsen/logrus"
+)
+
+// MailingListProvider keeps a Zoho Campaigns list in sync with our customers'
+// email addresses.
+//
+// Zoho Campaigns does not support maintaining a list of raw email addresses
+// that can be later updated or deleted via their API. So instead, we maintain
+// the email addresses of our customers in a Zoho Campaign "list", and
+// subscribe or unsubscribe them to this list.
+type MailingListProvider struct {
+	listKey     string
+	topicIDs    string
+	accessToken string
+	credentials Credentials
+}
+
+// NewMailingListProvider returns a Zoho backed implementation of the
+// MailingListProvider interface used by the MailingListsController.
+//
+// listKey identifies the Zoho Campaigns "list" that we use to keep track of
+// our customers' email addresses.
+//
+// topicIDs is a comma separated list of the Zoho topics that a contact
+// should be subscribed to on a `Subscribe` call.
+func NewMailingListProvider(listKey string, topicIDs string, accessToken string, credentials Credentials) *MailingListProvider {
+	return &MailingListProvider{
+		listKey:     listKey,
+		topicIDs:    topicIDs,
+		accessToken: accessToken,
+		credentials: credentials,
+	}
+}
+
+// Subscribe adds the given email address to our default Zoho Campaigns list.
+//
+// It is valid to resubscribe an email that has previously been unsubscribed.
+//
+// If topicIDs is non-empty, the contact is only subscribed to those topics
+// instead of the configured default set - this is how per-topic preferences
+// (see MailingListsController.SetSubscriptions) get translated into Zoho's
+// topic_id parameter.
+func (p *MailingListProvider) Subscribe(email string, topicIDs []ente.TopicID) error {
+	if p.shouldSkip() {
+		return stacktrace.Propagate(ente.ErrNotImplemented, "")
+	}
+
+	ids := p.topicIDs
+	if len(topicIDs) > 0 {
+		ids = joinTopicIDs(topicIDs)
+	}
+
+	// Need to set "Signup Form Disabled" in the list settings since we use
+	// this list to keep track of emails that have already been verified.
+	//
+	// > You can use this API to add contacts to your mailing lists. For
+	//   signup form enabled mailing lists, the contacts will receive a
+	//   confirmation email. For signup form disabled lists, contacts will be
+	//   added without any confirmations.
+	//
+	// https://www.zoho.com/campaigns/help/developers/contact-subscribe.html
+	return p.doListAction("listsubscribe", email, ids)
+}
+
+// Unsubscribe removes the given email address from our default Zoho
+// Campaigns list.
+//
+// If the contact has already been removed from Zoho's side (e.g. the
+// customer earlier chose "Erase my data" in a campaign email), Zoho
+// responds with a "Contact does not exist" error. We treat that as success,
+// since the end state - the contact is not in the list - is what we wanted.
+func (p *MailingListProvider) Unsubscribe(email string) error {
+	if p.shouldSkip() {
+		return stacktrace.Propagate(ente.ErrNotImplemented, "")
+	}
+
+	// https://www.zoho.com/campaigns/help/developers/contact-unsubscribe.html
+	err := p.doListAction("listunsubscribe", email, p.topicIDs)
+	if err != nil && strings.Contains(err.Error(), "Contact does not exist") {
+		return nil
+	}
+	return stacktrace.Propagate(err, "")
+}
+
+// ListTopics returns the Zoho topics that we can subscribe contacts to.
+//
+// Ostensibly, we can get them from their API
+// https://www.zoho.com/campaigns/oldhelp/api/get-topics.html
+//
+// But that doesn't currently work, luckily we can get these IDs by looking
+// at the HTML source of the topic update dashboard page, so they're
+// configured statically instead. We don't have human-readable names for
+// them from Zoho, so the topic ID doubles as its name.
+func (p *MailingListProvider) ListTopics() ([]ente.Topic, error) {
+	if p.topicIDs == "" {
+		return nil, nil
+	}
+	ids := strings.Split(p.topicIDs, ",")
+	topics := make([]ente.Topic, len(ids))
+	for i, id := range ids {
+		topics[i] = ente.Topic{ID: ente.TopicID(id), Name: id}
+	}
+	return topics, nil
+}
+
+func (p *MailingListProvider) shouldSkip() bool {
+	if p.credentials.RefreshToken == "" {
+		log.Info("Skipping Zoho mailing list update because credentials are not configured")
+		return true
+	}
+	return false
+}
+
+// Both the listsubscribe and listunsubscribe Zoho Campaigns API endpoints
+// work similarly, so use this function to keep the common code.
+func (p *MailingListProvider) doListAction(action string, email string, topicIDs string) error {
+	// Query escape the email so that any pluses get converted to %2B.
+	escapedEmail := url.QueryEscape(email)
+	contactInfo := fmt.Sprintf("{Contact+Email: \"%s\"}", escapedEmail)
+	// Instead of using QueryEscape, use PathEscape. QueryEscape escapes the
+	// "+" character, which causes Zoho API to not recognize the parameter.
+	escapedContactInfo := url.PathEscape(contactInfo)
+
+	reqURL := fmt.Sprintf(
+		"https://campaigns.zoho.com/api/v1.1/json/%s?resfmt=JSON&listkey=%s&contactinfo=%s&topic_id=%s",
+		action, p.listKey, escapedContactInfo, topicIDs)
+
+	accessToken, err := DoRequest("POST", reqURL, p.accessToken, p.credentials)
+	p.accessToken = accessToken
+
+	if err != nil {
+		// This is not necessarily an error, and can happen when the customer
+		// had earlier unsubscribed from our organization emails in Zoho,
+		// selecting the "Erase my data" option. This causes Zoho to remove
+		// the customer's entire record from their database.
+		//
+		// Then later, say if the customer deletes their account from ente,
+		// we would try to unsubscribe their email but it wouldn't be present
+		// in Zoho, and this API call would've failed.
+		//
+		// In such a case, Zoho will return the following response:
+		//
+		//   { code":"2103",
+		//     "message":"Contact does not exist.",
+		//     "version":"1.1",
+		//     "uri":"/api/v1.1/json/listunsubscribe",
+		//     "status":"error"}
+		//
+		// Special case these to reduce the severity level so as to not
+		// cause error log spam.
+		if strings.Contains(err.Error(), "Contact does not exist") {
+			log.Warnf("Zoho - Could not %s '%s': %s", action, email, err)
+		} else {
+			log.Errorf("Zoho - Could not %s '%s': %s", action, email, err)
+		}
+	}
+
+	return stacktrace.Propagate(err, "")
+}
+
+func joinTopicIDs(topicIDs []ente.TopicID) string {
+	ids := make([]string, len(topicIDs))
+	for i, id := range topicIDs {
+		ids[i] = string(id)
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/stacktrace"
+)
+
+// MailingListOpsRepository provides persistence for the mailing list outbox,
+// i.e. the `mailing_list_ops` table.
+type MailingListOpsRepository struct {
+	DB *sql.DB
+}
+
+// Enqueue inserts a new pending op that the worker should attempt as soon as
+// possible. topicIDs is only meaningful for MailingListOpSubscribe. Pass
+// hasTopicSelection = false (with a nil topicIDs) to mean "resolve the
+// account's current preferences at delivery time"; pass true to mean
+// "topicIDs is the selection, even if it is empty" (opted out of
+// everything).
+func (r *MailingListOpsRepository) Enqueue(opType ente.MailingListOpType, provider string, userID int64, email string, newEmail string, topicIDs []ente.TopicID, hasTopicSelection bool, nowMicro int64) error {
+	_, err := r.DB.Exec(`INSERT INTO mailing_list_ops
+			(op_type, provider, user_id, email, new_email, topic_ids, has_topic_selection, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)`,
+		opType, provider, userID, email, newEmail, joinTopicIDs(topicIDs), hasTopicSelection, nowMicro, nowMicro)
+	return stacktrace.Propagate(err, "")
+}
+
+// GetDueOps returns pending ops whose next_attempt_at has elapsed, oldest
+// first, up to limit rows.
+func (r *MailingListOpsRepository) GetDueOps(nowMicro int64, limit int) ([]ente.MailingListOp, error) {
+	rows, err := r.DB.Query(`SELECT id, op_type, provider, user_id, email, new_email, topic_ids,
+			has_topic_selection, attempt_count, next_attempt_at, last_error, status
+		FROM mailing_list_ops
+		WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY next_attempt_at ASC
+		LIMIT $3`, ente.MailingListOpStatusPending, nowMicro, limit)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "")
+	}
+	defer rows.Close()
+
+	return scanMailingListOps(rows)
+}
+
+// CountDueOps returns how many pending ops are due, for the outbox-depth
+// metric - unlike GetDueOps, this isn't bounded by a batch size, so it keeps
+// reflecting reality even once the backlog outgrows a single poll batch.
+func (r *MailingListOpsRepository) CountDueOps(nowMicro int64) (int, error) {
+	var count int
+	err := r.DB.QueryRow(`SELECT COUNT(*) FROM mailing_list_ops
+		WHERE status = $1 AND next_attempt_at <= $2`, ente.MailingListOpStatusPending, nowMicro).Scan(&count)
+	return count, stacktrace.Propagate(err, "")
+}
+
+// MarkSucceeded marks an op as done so the worker never picks it up again.
+func (r *MailingListOpsRepository) MarkSucceeded(id int64, nowMicro int64) error {
+	_, err := r.DB.Exec(`UPDATE mailing_list_ops
+		SET status = $1, updated_at = $2
+		WHERE id = $3`, ente.MailingListOpStatusDone, nowMicro, id)
+	return stacktrace.Propagate(err, "")
+}
+
+// MarkFailed records a failed attempt and schedules the next retry. If
+// attemptCount has reached maxAttempts, the op is dead-lettered instead of
+// being rescheduled.
+func (r *MailingListOpsRepository) MarkFailed(id int64, attemptCount int, maxAttempts int, lastError string, nextAttemptAt int64, nowMicro int64) error {
+	status := ente.MailingListOpStatusPending
+	if attemptCount >= maxAttempts {
+		status = ente.MailingListOpStatusDeadLettered
+	}
+	_, err := r.DB.Exec(`UPDATE mailing_list_ops
+		SET attempt_count = $1, next_attempt_at = $2, last_error = $3, status = $4, updated_at = $5
+		WHERE id = $6`, attemptCount, nextAttemptAt, lastError, status, nowMicro, id)
+	return stacktrace.Propagate(err, "")
+}
+
+// GetDeadLettered returns ops that exhausted their retries, for inspection
+// via the admin endpoint.
+func (r *MailingListOpsRepository) GetDeadLettered() ([]ente.MailingListOp, error) {
+	rows, err := r.DB.Query(`SELECT id, op_type, provider, user_id, email, new_email, topic_ids,
+			has_topic_selection, attempt_count, next_attempt_at, last_error, status
+		FROM mailing_list_ops
+		WHERE status = $1
+		ORDER BY updated_at DESC`, ente.MailingListOpStatusDeadLettered)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "")
+	}
+	defer rows.Close()
+
+	return scanMailingListOps(rows)
+}
+
+func scanMailingListOps(rows *sql.Rows) ([]ente.MailingListOp, error) {
+	var ops []ente.MailingListOp
+	for rows.Next() {
+		var op ente.MailingListOp
+		var topicIDs string
+		if err := rows.Scan(&op.ID, &op.Type, &op.Provider, &op.UserID, &op.Email, &op.NewEmail,
+			&topicIDs, &op.HasTopicSelection, &op.AttemptCount, &op.NextAttemptAt, &op.LastError, &op.Status); err != nil {
+			return nil, stacktrace.Propagate(err, "")
+		}
+		op.TopicIDs = splitTopicIDs(topicIDs)
+		ops = append(ops, op)
+	}
+	return ops, stacktrace.Propagate(rows.Err(), "")
+}
+
+func joinTopicIDs(topicIDs []ente.TopicID) string {
+	ids := make([]string, len(topicIDs))
+	for i, id := range topicIDs {
+		ids[i] = string(id)
+	}
+	return strings.Join(ids, ",")
+}
+
+func splitTopicIDs(joined string) []ente.TopicID {
+	if joined == "" {
+		return nil
+	}
+	parts := strings.Split(joined, ",")
+	topicIDs := make([]ente.TopicID, len(parts))
+	for i, p := range parts {
+		topicIDs[i] = ente.TopicID(p)
+	}
+	return topicIDs
+}
+
+// Requeue resets a dead-lettered op back to pending with a fresh attempt
+// count, so the worker picks it up again. Used by the admin "replay"
+// endpoint.
+func (r *MailingListOpsRepository) Requeue(id int64, nowMicro int64) error {
+	_, err := r.DB.Exec(`UPDATE mailing_list_ops
+		SET status = $1, attempt_count = 0, next_attempt_at = $2, updated_at = $2
+		WHERE id = $3 AND status = $4`,
+		ente.MailingListOpStatusPending, nowMicro, id, ente.MailingListOpStatusDeadLettered)
+	return stacktrace.Propagate(err, "")
+}
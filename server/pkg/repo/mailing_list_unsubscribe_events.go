@@ -0,0 +1,21 @@
+package repo
+
+import (
+	"database/sql"
+
+	"github.com/ente-io/stacktrace"
+)
+
+// MailingListUnsubscribeEventsRepository records why a customer used the
+// one-click unsubscribe link, for later analysis.
+type MailingListUnsubscribeEventsRepository struct {
+	DB *sql.DB
+}
+
+// Record stores a one-click unsubscribe event.
+func (r *MailingListUnsubscribeEventsRepository) Record(email string, listKey string, reason string, nowMicro int64) error {
+	_, err := r.DB.Exec(`INSERT INTO mailing_list_unsubscribe_events
+			(email, list_key, reason, created_at)
+		VALUES ($1, $2, $3, $4)`, email, listKey, reason, nowMicro)
+	return stacktrace.Propagate(err, "")
+}
@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"database/sql"
+
+	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/stacktrace"
+)
+
+// UserEmailPreferencesRepository provides persistence for a user's per-topic
+// mailing list opt in/out choices, i.e. the `user_email_preferences` table.
+type UserEmailPreferencesRepository struct {
+	DB *sql.DB
+}
+
+// GetSubscribedTopics returns the topics userID is currently subscribed to,
+// out of allTopics, along with whether userID has ever set any preferences
+// at all. A user who has never set any preferences (hasPreferences = false)
+// is treated as subscribed to everything, preserving the pre-existing
+// "subscribe to all topics" behaviour for accounts that signed up before
+// this feature existed - callers must check hasPreferences before treating
+// an empty result as "unsubscribed from everything", since that is also
+// what a user with no preferences on a provider with no topics would see.
+func (r *UserEmailPreferencesRepository) GetSubscribedTopics(userID int64, allTopics []ente.Topic) (subscribed []ente.TopicID, hasPreferences bool, err error) {
+	rows, err := r.DB.Query(`SELECT topic_id, subscribed FROM user_email_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, false, stacktrace.Propagate(err, "")
+	}
+	defer rows.Close()
+
+	overrides := make(map[ente.TopicID]bool)
+	for rows.Next() {
+		var topicID string
+		var topicSubscribed bool
+		if err := rows.Scan(&topicID, &topicSubscribed); err != nil {
+			return nil, false, stacktrace.Propagate(err, "")
+		}
+		overrides[ente.TopicID(topicID)] = topicSubscribed
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, stacktrace.Propagate(err, "")
+	}
+
+	subscribed, hasPreferences = mergeSubscribedTopics(allTopics, overrides)
+	return subscribed, hasPreferences, nil
+}
+
+// mergeSubscribedTopics is the pure part of GetSubscribedTopics - given the
+// per-topic overrides actually stored for a user, work out which of
+// allTopics they're subscribed to. A topic with no override, or an override
+// of true, counts as subscribed; this is what lets an account keep getting
+// topics added after they signed up without having opted out of them
+// specifically.
+func mergeSubscribedTopics(allTopics []ente.Topic, overrides map[ente.TopicID]bool) (subscribed []ente.TopicID, hasPreferences bool) {
+	for _, topic := range allTopics {
+		if override, ok := overrides[topic.ID]; !ok || override {
+			subscribed = append(subscribed, topic.ID)
+		}
+	}
+	return subscribed, len(overrides) > 0
+}
+
+// SetSubscribedTopics replaces userID's preferences with an explicit
+// subscribed/unsubscribed choice for every topic in allTopics.
+func (r *UserEmailPreferencesRepository) SetSubscribedTopics(userID int64, allTopics []ente.Topic, subscribedTopicIDs []ente.TopicID, nowMicro int64) error {
+	subscribed := make(map[ente.TopicID]bool, len(subscribedTopicIDs))
+	for _, id := range subscribedTopicIDs {
+		subscribed[id] = true
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.Exec(`DELETE FROM user_email_preferences WHERE user_id = $1`, userID); err != nil {
+		return stacktrace.Propagate(err, "")
+	}
+
+	for _, topic := range allTopics {
+		if _, err := tx.Exec(`INSERT INTO user_email_preferences (user_id, topic_id, subscribed, updated_at)
+				VALUES ($1, $2, $3, $4)`,
+			userID, topic.ID, subscribed[topic.ID], nowMicro); err != nil {
+			return stacktrace.Propagate(err, "")
+		}
+	}
+
+	return stacktrace.Propagate(tx.Commit(), "")
+}
@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ente-io/museum/ente"
+)
+
+func topics(ids ...ente.TopicID) []ente.Topic {
+	topics := make([]ente.Topic, len(ids))
+	for i, id := range ids {
+		topics[i] = ente.Topic{ID: id, Name: string(id)}
+	}
+	return topics
+}
+
+func TestMergeSubscribedTopicsNoPreferences(t *testing.T) {
+	subscribed, hasPreferences := mergeSubscribedTopics(topics("a", "b"), map[ente.TopicID]bool{})
+	if hasPreferences {
+		t.Fatal("expected hasPreferences to be false when no overrides exist")
+	}
+	if !reflect.DeepEqual(subscribed, []ente.TopicID{"a", "b"}) {
+		t.Fatalf("expected a user with no preferences to be subscribed to every topic, got %v", subscribed)
+	}
+}
+
+func TestMergeSubscribedTopicsExplicitOptOutOfEverything(t *testing.T) {
+	overrides := map[ente.TopicID]bool{"a": false, "b": false}
+	subscribed, hasPreferences := mergeSubscribedTopics(topics("a", "b"), overrides)
+	if !hasPreferences {
+		t.Fatal("expected hasPreferences to be true when overrides exist, even if all false")
+	}
+	if len(subscribed) != 0 {
+		t.Fatalf("expected no subscribed topics, got %v", subscribed)
+	}
+}
+
+func TestMergeSubscribedTopicsPartialOverride(t *testing.T) {
+	overrides := map[ente.TopicID]bool{"a": false}
+	subscribed, hasPreferences := mergeSubscribedTopics(topics("a", "b", "c"), overrides)
+	if !hasPreferences {
+		t.Fatal("expected hasPreferences to be true")
+	}
+	if !reflect.DeepEqual(subscribed, []ente.TopicID{"b", "c"}) {
+		t.Fatalf("expected b and c to remain subscribed, got %v", subscribed)
+	}
+}
+
+func TestMergeSubscribedTopicsIgnoresStaleOverride(t *testing.T) {
+	overrides := map[ente.TopicID]bool{"removed-topic": false}
+	subscribed, hasPreferences := mergeSubscribedTopics(topics("a"), overrides)
+	if !hasPreferences {
+		t.Fatal("expected hasPreferences to be true")
+	}
+	if !reflect.DeepEqual(subscribed, []ente.TopicID{"a"}) {
+		t.Fatalf("expected an override for a topic that no longer exists to be ignored, got %v", subscribed)
+	}
+}
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"database/sql"
+
+	"github.com/ente-io/museum/ente"
+	"github.com/ente-io/stacktrace"
+)
+
+// WebhookDeliveriesRepository provides persistence for the webhook outbox,
+// i.e. the `webhook_deliveries` table.
+type WebhookDeliveriesRepository struct {
+	DB *sql.DB
+}
+
+// Enqueue inserts a new pending delivery that the worker should attempt as
+// soon as possible.
+func (r *WebhookDeliveriesRepository) Enqueue(eventType ente.EventType, payload string, target string, secret string, nowMicro int64) error {
+	_, err := r.DB.Exec(`INSERT INTO webhook_deliveries
+			(event_type, payload, target, secret, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)`,
+		eventType, payload, target, secret, nowMicro, nowMicro)
+	return stacktrace.Propagate(err, "")
+}
+
+// GetDueOps returns pending deliveries whose next_attempt_at has elapsed,
+// oldest first, up to limit rows.
+func (r *WebhookDeliveriesRepository) GetDueOps(nowMicro int64, limit int) ([]ente.WebhookDelivery, error) {
+	rows, err := r.DB.Query(`SELECT id, event_type, payload, target, secret,
+			attempt_count, next_attempt_at, last_error, status
+		FROM webhook_deliveries
+		WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY next_attempt_at ASC
+		LIMIT $3`, ente.WebhookDeliveryStatusPending, nowMicro, limit)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "")
+	}
+	defer rows.Close()
+
+	return scanWebhookDeliveries(rows)
+}
+
+// MarkSucceeded marks a delivery as done so the worker never picks it up
+// again.
+func (r *WebhookDeliveriesRepository) MarkSucceeded(id int64, nowMicro int64) error {
+	_, err := r.DB.Exec(`UPDATE webhook_deliveries
+		SET status = $1, updated_at = $2
+		WHERE id = $3`, ente.WebhookDeliveryStatusDone, nowMicro, id)
+	return stacktrace.Propagate(err, "")
+}
+
+// MarkFailed records a failed attempt and schedules the next retry. If
+// attemptCount has reached maxAttempts, the delivery is dead-lettered
+// instead of being rescheduled.
+func (r *WebhookDeliveriesRepository) MarkFailed(id int64, attemptCount int, maxAttempts int, lastError string, nextAttemptAt int64, nowMicro int64) error {
+	status := ente.WebhookDeliveryStatusPending
+	if attemptCount >= maxAttempts {
+		status = ente.WebhookDeliveryStatusDeadLettered
+	}
+	_, err := r.DB.Exec(`UPDATE webhook_deliveries
+		SET attempt_count = $1, next_attempt_at = $2, last_error = $3, status = $4, updated_at = $5
+		WHERE id = $6`, attemptCount, nextAttemptAt, lastError, status, nowMicro, id)
+	return stacktrace.Propagate(err, "")
+}
+
+// GetDeadLettered returns deliveries that exhausted their retries, for
+// inspection via the admin endpoint.
+func (r *WebhookDeliveriesRepository) GetDeadLettered() ([]ente.WebhookDelivery, error) {
+	rows, err := r.DB.Query(`SELECT id, event_type, payload, target, secret,
+			attempt_count, next_attempt_at, last_error, status
+		FROM webhook_deliveries
+		WHERE status = $1
+		ORDER BY updated_at DESC`, ente.WebhookDeliveryStatusDeadLettered)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "")
+	}
+	defer rows.Close()
+
+	return scanWebhookDeliveries(rows)
+}
+
+// Requeue resets a dead-lettered delivery back to pending with a fresh
+// attempt count, so the worker picks it up again. Used by the admin
+// "replay" endpoint.
+func (r *WebhookDeliveriesRepository) Requeue(id int64, nowMicro int64) error {
+	_, err := r.DB.Exec(`UPDATE webhook_deliveries
+		SET status = $1, attempt_count = 0, next_attempt_at = $2, updated_at = $2
+		WHERE id = $3 AND status = $4`,
+		ente.WebhookDeliveryStatusPending, nowMicro, id, ente.WebhookDeliveryStatusDeadLettered)
+	return stacktrace.Propagate(err, "")
+}
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]ente.WebhookDelivery, error) {
+	var deliveries []ente.WebhookDelivery
+	for rows.Next() {
+		var d ente.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.EventType, &d.Payload, &d.Target, &d.Secret,
+			&d.AttemptCount, &d.NextAttemptAt, &d.LastError, &d.Status); err != nil {
+			return nil, stacktrace.Propagate(err, "")
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, stacktrace.Propagate(rows.Err(), "")
+}